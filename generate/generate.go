@@ -3,10 +3,17 @@ package main
 import (
 	"archive/zip"
 	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"flag"
 	"fmt"
+	"go/format"
 	"io"
 	"io/fs"
 	"maps"
@@ -23,20 +30,192 @@ var (
 	emojiData         = flag.String("emoji-data", "https://www.unicode.org/Public/16.0.0/ucd/emoji/emoji-data.txt", "URL for emoji data file")
 	emojiSequences    = flag.String("emoji-sequences", "https://www.unicode.org/Public/emoji/16.0/emoji-sequences.txt", "URL for emoji sequences file")
 	emojiZWJSequences = flag.String("emoji-zwj-sequences", "https://www.unicode.org/Public/emoji/16.0/emoji-zwj-sequences.txt", "URL for emoji ZWJ sequences file")
+	emojiTest         = flag.String("emoji-test", "https://unicode.org/Public/emoji/16.0/emoji-test.txt", "URL for the emoji-test data file (group/subgroup categorization)")
+	status            = flag.String("status", "fully-qualified", "Qualification status to read from emoji-test.txt: fully-qualified, minimally-qualified, unqualified, or component")
 	cldr              = flag.String("cldr", "https://unicode.org/Public/cldr/46/cldr-common-46.0.zip", "URL for CLDR data")
 	c                 = flag.String("c", "", "Cache dir")
+	locales           = flag.String("locales", "en", "Comma-separated list of BCP-47 locale tags to generate annotations for")
+	draft             = flag.String("draft", "approved", "Minimum annotation draft status to include: unconfirmed, provisional, contributed, or approved")
+	out               = flag.String("out", "", "Write a generated Go source file here instead of printing text to stdout; uses the first -locales tag")
+	pkg               = flag.String("package", "emoji", "Package name for the generated Go source file")
+	tags              = flag.String("tags", "", "Comma-separated build tags for the generated Go source file")
+	refresh           = flag.Bool("refresh", false, "Skip ETag/Last-Modified revalidation and force an unconditional re-download of every cached file")
+	offline           = flag.Bool("offline", false, "Never access the network; fail if a needed file isn't already cached")
+	sha256Sums        = flag.String("sha256", "", "Path to a sha256sums.txt file (sha256sum format) to verify cached downloads against; defaults to sha256sums.txt in the cache dir if present")
 )
 
+// draftLevels ranks the CLDR `draft` attribute values found on <annotation>
+// elements from least to most reviewed. An annotation with no draft
+// attribute at all is considered "approved".
+var draftLevels = map[string]int{
+	"unconfirmed": 0,
+	"provisional": 1,
+	"contributed": 2,
+	"approved":    3,
+}
+
+func draftLevel(attr string) int {
+	if attr == "" {
+		return draftLevels["approved"]
+	}
+	return draftLevels[attr]
+}
+
+// localeChain returns the CLDR locale inheritance chain for locale, from
+// "root" down to locale itself, e.g. "fr_CA" -> ["root", "fr", "fr_CA"].
+//
+// This is naive subtag-prefix truncation, not full CLDR parent-locale
+// resolution: it doesn't consult supplementalData's parentLocales
+// overrides, so locales with a non-default parent (e.g. "zh_Hant", whose
+// real parent is "root" rather than "zh") will walk through the wrong
+// intermediate locales. It's correct for the common case of a locale
+// whose subtags are already its true ancestors.
+func localeChain(locale string) []string {
+	locale = strings.ReplaceAll(locale, "-", "_")
+	tags := strings.Split(locale, "_")
+	chain := make([]string, 0, len(tags)+1)
+	chain = append(chain, "root")
+	for i := 1; i <= len(tags); i++ {
+		chain = append(chain, strings.Join(tags[:i], "_"))
+	}
+	return chain
+}
+
+// cacheMeta is the sidecar JSON stored alongside each cached download
+// (at "<name>.meta") so a later run can revalidate it instead of trusting
+// it to be fresh forever.
+type cacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func readCacheMeta(metaPath string) cacheMeta {
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return cacheMeta{}
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return cacheMeta{}
+	}
+	return meta
+}
+
+func writeCacheMeta(metaPath string, meta cacheMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, data, 0644)
+}
+
+// loadChecksums reads a sha256sums.txt-style file (lines of
+// "<hex digest>  <filename>", as produced by sha256sum) into a map from
+// filename to expected digest. A missing file is not an error: most cache
+// dirs won't have one.
+func loadChecksums(checksumsPath string) (map[string]string, error) {
+	data, err := os.ReadFile(checksumsPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("parse checksums file %q: bad line %q", checksumsPath, line)
+		}
+		sums[fields[1]] = fields[0]
+	}
+	return sums, nil
+}
+
+// verifyChecksum checks cachePath's sha256 digest against the one named
+// for it in -sha256 (or cacheDir/sha256sums.txt if -sha256 isn't set),
+// doing nothing if neither file mentions this particular cached file.
+func verifyChecksum(cachePath, cacheDir string) error {
+	checksumsPath := *sha256Sums
+	if checksumsPath == "" {
+		checksumsPath = cacheDir + "/sha256sums.txt"
+	}
+	checksums, err := loadChecksums(checksumsPath)
+	if err != nil {
+		return err
+	}
+	want, ok := checksums[path.Base(cachePath)]
+	if !ok {
+		return nil
+	}
+	f, err := os.Open(cachePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch for %q: got %s, want %s", cachePath, got, want)
+	}
+	return nil
+}
+
+// getCached returns the local path of url's contents, downloading it if
+// needed. Every cache hit is revalidated with the server using the
+// ETag/Last-Modified recorded the last time it was fetched, so -c never
+// pins a run to stale data the way a plain on-disk cache would; a 304
+// response keeps the cached copy without re-downloading it. -refresh
+// skips revalidation and forces an unconditional re-download even if the
+// server would otherwise answer 304. -offline forbids all network
+// access, failing if the file isn't already cached.
 func getCached(url, cacheDir string) (string, error) {
 	cachePath := cacheDir + "/" + path.Base(url)
-	if _, err := os.Stat(cachePath); !errors.Is(err, fs.ErrNotExist) {
-		return cachePath, nil
+	metaPath := cachePath + ".meta"
+	_, statErr := os.Stat(cachePath)
+	cached := !errors.Is(statErr, fs.ErrNotExist)
+
+	if *offline {
+		if cached {
+			if err := verifyChecksum(cachePath, cacheDir); err != nil {
+				return "", err
+			}
+			return cachePath, nil
+		}
+		return "", fmt.Errorf("-offline: %q is not cached in %q", url, cacheDir)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
 	}
-	resp, err := http.Get(url)
+	if cached && !*refresh {
+		meta := readCacheMeta(metaPath)
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		if err := verifyChecksum(cachePath, cacheDir); err != nil {
+			return "", err
+		}
+		return cachePath, nil
+	}
 	if resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("get %q: %s", url, resp.Status)
 	}
@@ -56,6 +235,16 @@ func getCached(url, cacheDir string) (string, error) {
 		os.Remove(cachePath)
 		return "", err
 	}
+	if err := writeCacheMeta(metaPath, cacheMeta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}); err != nil {
+		return "", err
+	}
+	if err := verifyChecksum(cachePath, cacheDir); err != nil {
+		return "", err
+	}
 	return cachePath, nil
 }
 
@@ -169,7 +358,93 @@ func emojis(cacheDir string) ([]string, error) {
 	return append(sequences, zwjSequences...), nil
 }
 
-func annotationsInFile(f io.Reader) (map[string]string, error) {
+// emojiCategory is the group/subgroup/listing-order metadata that
+// emoji-test.txt publishes alongside each emoji, which emoji-sequences.txt
+// and emoji-zwj-sequences.txt don't carry.
+type emojiCategory struct {
+	Group    string
+	Subgroup string
+	Order    int
+}
+
+// emojiCategories parses emoji-test.txt, returning the group, subgroup, and
+// listing order of every emoji whose status matches *status. The file is
+// organized into "# group: ..." and "# subgroup: ..." comment headers
+// followed by one data line per emoji; Order counts only the lines that
+// match the requested status, so it can be used directly as a secondary
+// sort key.
+func emojiCategories(cacheDir string) (map[string]emojiCategory, error) {
+	filePath, err := getCached(*emojiTest, cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	categories := make(map[string]emojiCategory)
+	var group, subgroup string
+	order := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, ok := strings.CutPrefix(line, "# group: "); ok {
+			group = rest
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "# subgroup: "); ok {
+			subgroup = rest
+			continue
+		}
+		data, _, _ := strings.Cut(line, "#")
+		if strings.TrimSpace(data) == "" {
+			continue
+		}
+		fields := strings.SplitN(data, ";", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("parse emoji-test.txt line %q", line)
+		}
+		if strings.TrimSpace(fields[1]) != *status {
+			continue
+		}
+		codepoints := strings.Fields(fields[0])
+		runes := make([]rune, len(codepoints))
+		for i, cp := range codepoints {
+			n, err := strconv.ParseInt(cp, 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("parse emoji-test.txt line %q: %s", line, err)
+			}
+			runes[i] = rune(n)
+		}
+		categories[removePresentationSelector(string(runes))] = emojiCategory{Group: group, Subgroup: subgroup, Order: order}
+		order++
+	}
+	return categories, scanner.Err()
+}
+
+// annotationInfo holds the CLDR name ("tts") and search keywords for a
+// single emoji, kept separate so consumers that want structured data (see
+// writeGoSource) don't have to reparse the combined text form.
+type annotationInfo struct {
+	name     string
+	keywords []string
+}
+
+// String renders the annotation the same way the tool has always printed
+// it to stdout: the name followed by any keywords not already implied by
+// it, all on one space-separated line.
+func (a annotationInfo) String() string {
+	s := strings.ReplaceAll(a.name, ": ", " ")
+	s = strings.ReplaceAll(s, ", ", " ")
+	if len(a.keywords) > 0 {
+		s += " " + strings.Join(a.keywords, " ")
+	}
+	return s
+}
+
+func annotationsInFile(f io.Reader, minDraft int) (map[string]annotationInfo, error) {
 	contents, err := io.ReadAll(f)
 	if err != nil {
 		return nil, fmt.Errorf("read CLDR data: %s", err)
@@ -178,6 +453,7 @@ func annotationsInFile(f io.Reader) (map[string]string, error) {
 		Annotations []struct {
 			CP         string `xml:"cp,attr"`
 			Type       string `xml:"type,attr"`
+			Draft      string `xml:"draft,attr"`
 			Annotation string `xml:",chardata"`
 		} `xml:"annotations>annotation"`
 	}
@@ -185,65 +461,336 @@ func annotationsInFile(f io.Reader) (map[string]string, error) {
 		return nil, fmt.Errorf("parse CLDR data: %s", err)
 	}
 
-	type annotationData struct {
-		name        string
-		annotations []string
-	}
-	emojiAnnotations := make(map[string]annotationData)
+	emojiAnnotations := make(map[string]annotationInfo)
 	for _, annotation := range annotations.Annotations {
-		annotationData := emojiAnnotations[annotation.CP]
+		if draftLevel(annotation.Draft) < minDraft {
+			continue
+		}
+		info := emojiAnnotations[annotation.CP]
 		if annotation.Type == "tts" {
-			annotationData.name = annotation.Annotation
+			info.name = annotation.Annotation
 		} else {
-			annotations := strings.Split(annotation.Annotation, "|")
-			for i, a := range annotations {
-				annotations[i] = strings.TrimSpace(a)
+			keywords := strings.Split(annotation.Annotation, "|")
+			for i, k := range keywords {
+				keywords[i] = strings.TrimSpace(k)
 			}
-			annotationData.annotations = annotations
+			info.keywords = keywords
 		}
-		emojiAnnotations[annotation.CP] = annotationData
+		emojiAnnotations[annotation.CP] = info
+	}
+	for emoji, info := range emojiAnnotations {
+		info.keywords = slices.DeleteFunc(info.keywords, func(s string) bool { return strings.Contains(info.name, s) })
+		emojiAnnotations[emoji] = info
 	}
-	annotationsCombined := make(map[string]string, len(emojiAnnotations))
-	for emoji, annotation := range emojiAnnotations {
-		annotation.annotations = slices.DeleteFunc(annotation.annotations, func(s string) bool { return strings.Contains(annotation.name, s) })
-		annotationsStr := strings.ReplaceAll(annotation.name, ": ", " ")
-		annotationsStr = strings.ReplaceAll(annotationsStr, ", ", " ")
-		if len(annotation.annotations) > 0 {
-			annotationsStr += " " + strings.Join(annotation.annotations, " ")
+	return emojiAnnotations, nil
+}
+
+// annotationsForTag reads the CLDR annotations and annotationsDerived data
+// for a single locale tag (no inheritance resolution). Either or both files
+// may be absent for a given tag, which is not an error: most locale tags
+// only override a handful of annotations and rely on their parent locale
+// for everything else.
+func annotationsForTag(cldrData *zip.Reader, tag string, minDraft int) (map[string]annotationInfo, error) {
+	combined := make(map[string]annotationInfo)
+	for _, dir := range []string{"common/annotations", "common/annotationsDerived"} {
+		file, err := cldrData.Open(dir + "/" + tag + ".xml")
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read CLDR data: %s", err)
+		}
+		data, err := annotationsInFile(file, minDraft)
+		file.Close()
+		if err != nil {
+			return nil, err
 		}
-		annotationsCombined[emoji] = annotationsStr
+		maps.Copy(combined, data)
 	}
-	return annotationsCombined, nil
+	return combined, nil
 }
 
-func annotations(cldrData *zip.Reader) (map[string]string, error) {
-	annotationsFile, err := cldrData.Open("common/annotations/en.xml")
-	if err != nil {
-		return nil, fmt.Errorf("read CLDR data: %s", err)
+// annotations resolves CLDR annotations for locale by walking its
+// inheritance chain from "root" down to locale itself, merging as it goes
+// so that more specific locales override their ancestors.
+func annotations(cldrData *zip.Reader, locale string, minDraft int) (map[string]annotationInfo, error) {
+	merged := make(map[string]annotationInfo)
+	for _, tag := range localeChain(locale) {
+		data, err := annotationsForTag(cldrData, tag, minDraft)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(merged, data)
 	}
-	defer annotationsFile.Close()
-	annotations, err := annotationsInFile(annotationsFile)
-	if err != nil {
-		return nil, err
+	return merged, nil
+}
+
+func removePresentationSelector(emoji string) string {
+	return strings.ReplaceAll(emoji, "\ufe0f", "")
+}
+
+// collationRelation is how a tailoring rule token relates a collation
+// element to the one immediately before it in the resulting order.
+type collationRelation int
+
+const (
+	relationPrimary   collationRelation = iota // <   new base weight
+	relationSecondary                          // <<  same primary, new secondary
+	relationTertiary                           // <<< same primary/secondary, new tertiary
+	relationEqual                              // =   exact tie with the previous element
+)
+
+// collationNode is one entry in the tailoring's collation element list: the
+// text it represents (a single character, or a multi-character contraction
+// joined with "|"), and how it relates to whichever node precedes it once
+// the whole rule set has been applied.
+type collationNode struct {
+	key      string
+	relation collationRelation
+}
+
+// collationWeight is a collation element's primary/secondary/tertiary
+// weight, UCA-style.
+type collationWeight struct {
+	primary, secondary, tertiary uint32
+}
+
+// bytes packs the weight into a fixed-width, big-endian byte string, so
+// that comparing two weights with bytes.Compare (or a plain string "<")
+// gives the same answer as comparing primary, then secondary, then
+// tertiary numerically.
+func (w collationWeight) bytes() []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint32(b[0:4], w.primary)
+	binary.BigEndian.PutUint32(b[4:8], w.secondary)
+	binary.BigEndian.PutUint32(b[8:12], w.tertiary)
+	return b
+}
+
+// lexCollationLine splits one line of CLDR tailoring-rule syntax into
+// operator tokens ("&", "<", "<<", "<<<", "=", "*", "|"), bracketed special
+// positions ("[first tertiary ignorable]", "[before 1]", ...), quoted
+// literals ('...'), and runs of literal characters.
+func lexCollationLine(line string) []string {
+	var tokens []string
+	i := 0
+	for i < len(line) {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		switch {
+		case r == ' ' || r == '\t':
+			i += size
+		case r == '[':
+			if end := strings.IndexByte(line[i:], ']'); end >= 0 {
+				tokens = append(tokens, line[i:i+end+1])
+				i += end + 1
+			} else {
+				tokens = append(tokens, line[i:])
+				i = len(line)
+			}
+		case r == '\'':
+			if end := strings.IndexByte(line[i+size:], '\''); end >= 0 {
+				tokens = append(tokens, line[i+size:i+size+end])
+				i += size + end + 1
+			} else {
+				tokens = append(tokens, line[i+size:])
+				i = len(line)
+			}
+		case strings.HasPrefix(line[i:], "<<<"):
+			tokens = append(tokens, "<<<")
+			i += 3
+		case strings.HasPrefix(line[i:], "<<"):
+			tokens = append(tokens, "<<")
+			i += 2
+		case r == '<' || r == '=' || r == '&' || r == '*' || r == '|':
+			tokens = append(tokens, string(r))
+			i += size
+		default:
+			start := i
+			for i < len(line) {
+				r, size := utf8.DecodeRuneInString(line[i:])
+				if strings.ContainsRune(" \t[']<=&*|", r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, line[start:i])
+		}
 	}
-	annotationsDerivedFile, err := cldrData.Open("common/annotationsDerived/en.xml")
-	if err != nil {
-		return nil, fmt.Errorf("read CLDR data: %s", err)
+	return tokens
+}
+
+// beforeLevel reports the level (1 = primary, 2 = secondary, 3 = tertiary)
+// named by a "[before N]" token, or 0 if it doesn't request one.
+func beforeLevel(token string) int {
+	switch {
+	case strings.Contains(token, "1"):
+		return 1
+	case strings.Contains(token, "2"):
+		return 2
+	case strings.Contains(token, "3"):
+		return 3
+	default:
+		return 0
 	}
-	defer annotationsDerivedFile.Close()
-	annotationsDerived, err := annotationsInFile(annotationsDerivedFile)
-	if err != nil {
-		return nil, err
+}
+
+// resolveAnchor finds the list node a reset ("&") token refers to, creating
+// it if this is the first time the tailoring mentions it. Bracketed
+// special positions like "[first tertiary ignorable]" aren't backed by a
+// real DUCET here, so they're created on first use: "[first ...]" anchors
+// at the very start of the order, everything else at the very end.
+func resolveAnchor(target string, elements *list.List, byKey map[string]*list.Element) *list.Element {
+	target = strings.Trim(target, "'")
+	if e, ok := byKey[target]; ok {
+		return e
+	}
+	node := &collationNode{key: target}
+	var e *list.Element
+	if strings.HasPrefix(target, "[first") {
+		e = elements.PushFront(node)
+	} else {
+		e = elements.PushBack(node)
 	}
-	maps.Copy(annotations, annotationsDerived)
-	return annotations, err
+	byKey[target] = e
+	return e
 }
 
-func removePresentationSelector(emoji string) string {
-	return strings.ReplaceAll(emoji, "\ufe0f", "")
+// insertElement places a new collation element into the tailoring order
+// relative to anchor: after it normally, or before it when a preceding
+// "[before N]" asked for that. Every following element in the list
+// implicitly shifts down in the final ordering once weights are computed,
+// since weights are derived from list position, not assigned up front.
+func insertElement(elements *list.List, byKey map[string]*list.Element, anchor *list.Element, before int, relation collationRelation, text string) *list.Element {
+	node := &collationNode{key: text, relation: relation}
+	var e *list.Element
+	if before > 0 {
+		e = elements.InsertBefore(node, anchor)
+	} else {
+		e = elements.InsertAfter(node, anchor)
+	}
+	byKey[text] = e
+	return e
 }
 
-func collationData(cldrData *zip.Reader) (func(string) int, error) {
+// parseCollationRules parses a CLDR tailoring rule set (the contents of a
+// <cr> element) into an ordered doubly-linked list of collation elements,
+// an index from element text to its node, and the set of runes that the
+// rules mark as "[last primary ignorable]" combining tailorings - trailing
+// skin-tone/hair-style/gender modifiers that should be stripped before
+// looking an emoji sequence up when it isn't tailored directly.
+//
+// The rules are lexed per line (comments and blank lines are stripped a
+// line at a time), but parsed as a single token stream: a reset chain like
+// "&a\n< b\n< c" is pretty-printed across lines without repeating "&" on
+// each continuation line, so the current reset/relation state has to
+// survive newlines and only actually reset on an explicit "&" token.
+func parseCollationRules(rules string) (*list.List, map[string]*list.Element, map[rune]bool, error) {
+	elements := list.New()
+	byKey := make(map[string]*list.Element)
+	ignorable := make(map[rune]bool)
+
+	var tokens []string
+	for _, line := range strings.Split(rules, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, lexCollationLine(line)...)
+	}
+
+	var anchor *list.Element
+	lastReset := ""
+	relation := relationPrimary
+	listMode := false
+	before := 0
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok {
+		case "&":
+			i++
+			if i < len(tokens) && strings.HasPrefix(tokens[i], "[before") {
+				before = beforeLevel(tokens[i])
+				i++
+			} else {
+				before = 0
+			}
+			if i >= len(tokens) {
+				return nil, nil, nil, fmt.Errorf("collation rules: reset with no target")
+			}
+			anchor = resolveAnchor(tokens[i], elements, byKey)
+			lastReset = tokens[i]
+			listMode = false
+		case "<<<":
+			relation, listMode = relationTertiary, false
+		case "<<":
+			relation, listMode = relationSecondary, false
+		case "<":
+			relation, listMode = relationPrimary, false
+		case "=":
+			relation, listMode = relationEqual, false
+		case "*":
+			listMode = true
+		default:
+			text := tok
+			if i+1 < len(tokens) && tokens[i+1] == "|" {
+				i += 2
+				if i < len(tokens) {
+					text += tokens[i]
+				}
+			}
+			if anchor == nil {
+				return nil, nil, nil, fmt.Errorf("collation rules: element %q has no preceding reset", text)
+			}
+			if listMode {
+				for _, r := range text {
+					anchor = insertElement(elements, byKey, anchor, before, relation, string(r))
+					before = 0
+					if lastReset == "[last primary ignorable]" {
+						ignorable[r] = true
+					}
+				}
+			} else {
+				anchor = insertElement(elements, byKey, anchor, before, relation, text)
+				before = 0
+				if lastReset == "[last primary ignorable]" && utf8.RuneCountInString(text) == 1 {
+					r, _ := utf8.DecodeRuneInString(text)
+					ignorable[r] = true
+				}
+			}
+		}
+	}
+	return elements, byKey, ignorable, nil
+}
+
+// collationWeights walks elements in final order, assigning each one a
+// weight: a "<" bumps the primary and resets secondary/tertiary to zero, a
+// "<<" bumps the secondary and resets tertiary, a "<<<" only bumps the
+// tertiary, and "=" repeats the previous element's weight exactly. It also
+// returns the weight one past the last element, used as a sort-to-the-end
+// fallback for emoji the tailoring never mentions.
+func collationWeights(elements *list.List) (map[string]collationWeight, collationWeight) {
+	weights := make(map[string]collationWeight, elements.Len())
+	var w collationWeight
+	for e := elements.Front(); e != nil; e = e.Next() {
+		node := e.Value.(*collationNode)
+		switch node.relation {
+		case relationSecondary:
+			w.secondary++
+			w.tertiary = 0
+		case relationTertiary:
+			w.tertiary++
+		case relationEqual:
+			// Ties with the previous element; weight unchanged.
+		default: // relationPrimary
+			w.primary++
+			w.secondary, w.tertiary = 0, 0
+		}
+		weights[node.key] = w
+	}
+	return weights, collationWeight{primary: w.primary + 1}
+}
+
+func collationData(cldrData *zip.Reader) (func(string) []byte, error) {
 	file, err := cldrData.Open("common/collation/root.xml")
 	if err != nil {
 		return nil, fmt.Errorf("read CLDR data: %s", err)
@@ -272,44 +819,24 @@ func collationData(cldrData *zip.Reader) (func(string) int, error) {
 	if emojiCollation == "" {
 		return nil, fmt.Errorf("no emoji collation found in %q", file)
 	}
-	// ðŸ«¤
-	ignorable := make(map[rune]bool)
-	collation := make(map[string]int)
-	count := 1
-	for _, line := range strings.Split(emojiCollation, "\n") {
-		if line, ok := strings.CutPrefix(line, "& [last primary ignorable]<<*"); ok {
-			for _, rune := range line {
-				ignorable[rune] = true
-			}
-		}
-		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "&") {
-			continue
-		}
-		if strings.HasPrefix(line, "<*") {
-			for _, emoji := range line[2:] {
-				collation[string([]rune{emoji})] = count
-				count++
-			}
-		} else if strings.HasPrefix(line, "<") {
-			for _, emoji := range strings.FieldsFunc(line[1:], func(r rune) bool { return r == ' ' || r == '<' || r == '=' || r == '\'' }) {
-				collation[emoji] = count
-				count++
-			}
-		} else {
-			return nil, fmt.Errorf("unexpected line format %q", line)
-		}
+
+	elements, _, ignorable, err := parseCollationRules(emojiCollation)
+	if err != nil {
+		return nil, fmt.Errorf("parse emoji collation tailoring: %s", err)
 	}
-	return func(emoji string) int {
+	weights, fallback := collationWeights(elements)
+
+	return func(emoji string) []byte {
 		// First try the minimally qualified version, with one trailing
 		// modifier removed.
 		minimallyQualified := removePresentationSelector(emoji)
 		lastRune, size := utf8.DecodeLastRuneInString(minimallyQualified)
 		if size < len(minimallyQualified) && ignorable[lastRune] {
 			minimallyQualified = minimallyQualified[:len(minimallyQualified)-size]
-			minimallyQualified = strings.TrimSuffix(minimallyQualified, "\u200d") // ZWJ
+			minimallyQualified = strings.TrimSuffix(minimallyQualified, "‍") // ZWJ
 		}
-		if n, ok := collation[minimallyQualified]; ok {
-			return n
+		if w, ok := weights[minimallyQualified]; ok {
+			return w.bytes()
 		}
 		// If that's not found, try the fully unqualified version,
 		// where we remove all modifiers.
@@ -321,21 +848,96 @@ func collationData(cldrData *zip.Reader) (func(string) int, error) {
 			}
 		}
 		unqualified = string(unqualifiedRunes)
-		unqualified = strings.TrimRight(unqualified, "\u200d") // ZWJ
-		if n, ok := collation[unqualified]; ok {
-			return n
+		unqualified = strings.TrimRight(unqualified, "‍") // ZWJ
+		if w, ok := weights[unqualified]; ok {
+			return w.bytes()
 		}
 		// Finally, fall back to checking the first codepoint.
 		firstRune, _ := utf8.DecodeRuneInString(emoji)
-		if n, ok := collation[string([]rune{firstRune})]; ok {
-			return n
+		if w, ok := weights[string([]rune{firstRune})]; ok {
+			return w.bytes()
 		}
-		fmt.Fprintf(os.Stderr, "Unable to classify emoji %s", emoji)
-		os.Exit(1)
-		panic("unreachable")
+		fmt.Fprintf(os.Stderr, "Unable to classify emoji %s, sorting it last\n", emoji)
+		return fallback.bytes()
 	}, nil
 }
 
+// tableEntry is one row of the generated Go source table. It mirrors the
+// Emoji struct written by writeGoSource. SortKey holds the raw bytes of a
+// collation sort key, stored as a string so consumers can order by it with
+// a plain "<" comparison.
+type tableEntry struct {
+	Sequence string
+	Name     string
+	Keywords []string
+	Group    string
+	Subgroup string
+	SortKey  string
+}
+
+// keywordsLiteral renders keywords as a Go slice literal suitable for
+// embedding directly in generated source.
+func keywordsLiteral(keywords []string) string {
+	if len(keywords) == 0 {
+		return "nil"
+	}
+	quoted := make([]string, len(keywords))
+	for i, k := range keywords {
+		quoted[i] = fmt.Sprintf("%q", k)
+	}
+	return "[]string{" + strings.Join(quoted, ", ") + "}"
+}
+
+// writeGoSource emits a gofmt'd Go source file declaring an Emoji type, an
+// All table in entries order, and an Index mapping each sequence back to
+// its position in All. This follows the pattern used by x/text's
+// maketables.go generators: a "Code generated ... DO NOT EDIT" header, an
+// optional build-tag line, then plain data declarations.
+func writeGoSource(w io.Writer, pkg, buildTags string, entries []tableEntry) error {
+	var b strings.Builder
+	fmt.Fprintln(&b, "// Code generated by generate; DO NOT EDIT.")
+	if buildTags != "" {
+		fmt.Fprintf(&b, "\n//go:build %s\n", strings.ReplaceAll(buildTags, ",", " && "))
+	}
+	fmt.Fprintf(&b, "\npackage %s\n\n", pkg)
+
+	fmt.Fprintln(&b, "// Emoji describes a single emoji sequence and its CLDR annotations.")
+	fmt.Fprintln(&b, "type Emoji struct {")
+	fmt.Fprintln(&b, "\tSequence string")
+	fmt.Fprintln(&b, "\tName     string")
+	fmt.Fprintln(&b, "\tKeywords []string")
+	fmt.Fprintln(&b, "\tGroup    string")
+	fmt.Fprintln(&b, "\tSubgroup string")
+	fmt.Fprintln(&b, "\t// SortKey is a collation sort key: comparing two emoji's SortKey")
+	fmt.Fprintln(&b, "\t// with \"<\" orders them the way CLDR collation does.")
+	fmt.Fprintln(&b, "\tSortKey string")
+	fmt.Fprintln(&b, "}")
+	fmt.Fprintln(&b)
+
+	fmt.Fprintln(&b, "// All lists every emoji sequence, sorted by SortKey.")
+	fmt.Fprintln(&b, "var All = []Emoji{")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "\t{Sequence: %q, Name: %q, Keywords: %s, Group: %q, Subgroup: %q, SortKey: %q},\n",
+			e.Sequence, e.Name, keywordsLiteral(e.Keywords), e.Group, e.Subgroup, e.SortKey)
+	}
+	fmt.Fprintln(&b, "}")
+	fmt.Fprintln(&b)
+
+	fmt.Fprintln(&b, "// Index maps an emoji sequence to its position in All.")
+	fmt.Fprintln(&b, "var Index = map[string]int{")
+	for i, e := range entries {
+		fmt.Fprintf(&b, "\t%q: %d,\n", e.Sequence, i)
+	}
+	fmt.Fprintln(&b, "}")
+
+	formatted, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return fmt.Errorf("gofmt generated source: %s", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
 func generate() error {
 	cacheDir := *c
 	if cacheDir == "" {
@@ -350,6 +952,10 @@ func generate() error {
 	if err != nil {
 		return err
 	}
+	categories, err := emojiCategories(cacheDir)
+	if err != nil {
+		return err
+	}
 
 	cldrFile, err := getCached(*cldr, cacheDir)
 	if err != nil {
@@ -360,16 +966,23 @@ func generate() error {
 		return err
 	}
 	defer cldrData.Close()
-	annotations, err := annotations(&cldrData.Reader)
-	if err != nil {
-		return err
-	}
 	collate, err := collationData(&cldrData.Reader)
 	if err != nil {
 		return err
 	}
+	categoryByEmoji := make(map[string]emojiCategory, len(emojis))
+	for _, emoji := range emojis {
+		category, ok := categories[removePresentationSelector(emoji)]
+		if !ok {
+			return fmt.Errorf("emoji %q has no category in %s", emoji, *emojiTest)
+		}
+		categoryByEmoji[emoji] = category
+	}
 	slices.SortFunc(emojis, func(e, f string) int {
-		if n := collate(e) - collate(f); n != 0 {
+		if n := bytes.Compare(collate(e), collate(f)); n != 0 {
+			return n
+		}
+		if n := categoryByEmoji[e].Order - categoryByEmoji[f].Order; n != 0 {
 			return n
 		}
 		if n := strings.Count(e, "\u200d") - strings.Count(f, "\u200d"); n != 0 {
@@ -377,14 +990,60 @@ func generate() error {
 		}
 		return slices.Compare([]rune(e), []rune(f))
 	})
-	for _, emoji := range emojis {
-		// From CLDR: "Warnings: All cp values have U+FE0F characters removed."
-		// So we have to remove all fe0f characters for some reason.
-		annotation, ok := annotations[removePresentationSelector(emoji)]
-		if !ok {
-			return fmt.Errorf("emoji %q has no annotation", emoji)
+
+	minDraft, ok := draftLevels[*draft]
+	if !ok {
+		return fmt.Errorf("unknown -draft level %q", *draft)
+	}
+	localeList := strings.Split(*locales, ",")
+
+	if *out != "" {
+		annotations, err := annotations(&cldrData.Reader, localeList[0], minDraft)
+		if err != nil {
+			return err
+		}
+		entries := make([]tableEntry, 0, len(emojis))
+		for _, emoji := range emojis {
+			annotation, ok := annotations[removePresentationSelector(emoji)]
+			if !ok {
+				return fmt.Errorf("emoji %q has no annotation for locale %q", emoji, localeList[0])
+			}
+			category := categoryByEmoji[emoji]
+			entries = append(entries, tableEntry{
+				Sequence: emoji,
+				Name:     annotation.name,
+				Keywords: annotation.keywords,
+				Group:    category.Group,
+				Subgroup: category.Subgroup,
+				SortKey:  string(collate(emoji)),
+			})
+		}
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return writeGoSource(f, *pkg, *tags, entries)
+	}
+
+	for i, locale := range localeList {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("=== %s ===\n", locale)
+		annotations, err := annotations(&cldrData.Reader, locale, minDraft)
+		if err != nil {
+			return err
+		}
+		for _, emoji := range emojis {
+			// From CLDR: "Warnings: All cp values have U+FE0F characters removed."
+			// So we have to remove all fe0f characters for some reason.
+			annotation, ok := annotations[removePresentationSelector(emoji)]
+			if !ok {
+				return fmt.Errorf("emoji %q has no annotation for locale %q", emoji, locale)
+			}
+			fmt.Println(emoji, annotation)
 		}
-		fmt.Println(emoji, annotation)
 	}
 	return nil
 }
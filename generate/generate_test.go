@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseCollationRulesMultiLine(t *testing.T) {
+	// CLDR tailoring rules are conventionally pretty-printed with one
+	// relation per line and "&" only on the first line of a reset chain.
+	const rules = "&a\n< b\n< c\n<< d"
+
+	elements, _, _, err := parseCollationRules(rules)
+	if err != nil {
+		t.Fatalf("parseCollationRules(%q): %v", rules, err)
+	}
+	weights, _ := collationWeights(elements)
+
+	a, b, c, d := weights["a"], weights["b"], weights["c"], weights["d"]
+	if a.primary >= b.primary {
+		t.Errorf("want a < b, got a=%+v b=%+v", a, b)
+	}
+	if b.primary >= c.primary {
+		t.Errorf("want b < c, got b=%+v c=%+v", b, c)
+	}
+	if d.primary != c.primary || d.secondary <= c.secondary {
+		t.Errorf("want d to be a secondary-level tailoring of c, got c=%+v d=%+v", c, d)
+	}
+}
+
+func TestParseCollationRulesBeforeList(t *testing.T) {
+	// "[before 1]" inserts before its anchor rather than after, and "*"
+	// expands a run of literals into one list-form tailoring per rune.
+	const rules = "&a\n< b\n< c\n& [before 1] b * d e"
+
+	elements, _, _, err := parseCollationRules(rules)
+	if err != nil {
+		t.Fatalf("parseCollationRules(%q): %v", rules, err)
+	}
+	weights, _ := collationWeights(elements)
+
+	a, d, e, b, c := weights["a"], weights["d"], weights["e"], weights["b"], weights["c"]
+	if !(a.primary < d.primary && d.primary < e.primary && e.primary < b.primary && b.primary < c.primary) {
+		t.Errorf("want a < d < e < b < c, got a=%+v d=%+v e=%+v b=%+v c=%+v", a, d, e, b, c)
+	}
+}
+
+func TestParseCollationRulesContraction(t *testing.T) {
+	// "x|y" is a contraction: it tailors the two-character string "xy" as
+	// a single element, not "x" followed by "y".
+	const rules = "&a\n< b|h"
+
+	elements, _, _, err := parseCollationRules(rules)
+	if err != nil {
+		t.Fatalf("parseCollationRules(%q): %v", rules, err)
+	}
+	weights, _ := collationWeights(elements)
+
+	if _, ok := weights["bh"]; !ok {
+		t.Fatalf("want a tailoring for contraction %q, got %+v", "bh", weights)
+	}
+	if _, ok := weights["b"]; ok {
+		t.Errorf("contraction %q shouldn't also produce a standalone tailoring for %q", "bh", "b")
+	}
+	if weights["a"].primary >= weights["bh"].primary {
+		t.Errorf("want a < bh, got a=%+v bh=%+v", weights["a"], weights["bh"])
+	}
+}
+
+func TestParseCollationRulesEqual(t *testing.T) {
+	// "=" ties an element to its predecessor's weight exactly.
+	const rules = "&a\n< b\n= c"
+
+	elements, _, _, err := parseCollationRules(rules)
+	if err != nil {
+		t.Fatalf("parseCollationRules(%q): %v", rules, err)
+	}
+	weights, _ := collationWeights(elements)
+
+	if weights["b"] != weights["c"] {
+		t.Errorf("want b and c to tie, got b=%+v c=%+v", weights["b"], weights["c"])
+	}
+	if weights["a"].primary >= weights["b"].primary {
+		t.Errorf("want a < b, got a=%+v b=%+v", weights["a"], weights["b"])
+	}
+}
+
+func TestParseCollationRulesLastPrimaryIgnorable(t *testing.T) {
+	// "& [last primary ignorable] << * ..." is how root.xml marks the
+	// combining skin-tone/hair-style modifiers that should be stripped
+	// before looking up an emoji sequence the tailoring doesn't mention
+	// directly; parseCollationRules records those runes in its third
+	// return value.
+	const rules = "&a\n& [last primary ignorable] << * bc"
+
+	_, _, ignorable, err := parseCollationRules(rules)
+	if err != nil {
+		t.Fatalf("parseCollationRules(%q): %v", rules, err)
+	}
+
+	if !ignorable['b'] || !ignorable['c'] {
+		t.Errorf("want 'b' and 'c' marked ignorable, got %v", ignorable)
+	}
+	if ignorable['a'] {
+		t.Errorf("'a' wasn't reset under [last primary ignorable], shouldn't be marked ignorable")
+	}
+}